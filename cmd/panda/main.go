@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"strings"
 
 	"github.com/panda-foundation/panda/compiler"
 )
@@ -21,16 +20,22 @@ func main() {
 	#end
 	`
 
-	var s compiler.Scanner
-	s.Init(strings.NewReader(src), false, []string{"windows"})
-	for token := s.Scan(); token != compiler.TypeEOF; token = s.Scan() {
-		if s.ErrorCount > 0 {
+	fset := compiler.NewFileSet()
+	file := fset.AddFile("main.panda", len(src))
+
+	errorHandler := func(position compiler.Position, msg string) {
+		fmt.Printf("%s: %s\n", position, msg)
+	}
+
+	scanner := compiler.NewScanner(file, []byte(src), errorHandler, false, []string{"windows"})
+	for {
+		pos, token, literal := scanner.Scan()
+		if scanner.ErrorCount > 0 {
 			break
 		}
-		newLine := "\n"
-		if token == compiler.TypeNewLine {
-			newLine = ""
+		if token == compiler.EOF {
+			break
 		}
-		fmt.Printf("type %s %s: %s%s", compiler.TokenToString(token), s.Position, s.TokenText(), newLine)
+		fmt.Printf("%s %s: %q\n", fset.Position(pos), token, literal)
 	}
 }
@@ -0,0 +1,190 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Pos is a compact encoding of a source position within a FileSet: the
+// offset of a File plus the byte offset into that file. The zero Pos is
+// the position of no file and no position.
+type Pos int
+
+// NoPos is the zero value for Pos; it is never a valid position.
+const NoPos Pos = 0
+
+// Position describes a fully resolved source location.
+type Position struct {
+	Filename string // filename, if any
+	Offset   int    // offset, starting at 0
+	Line     int    // line number, starting at 1
+	Column   int    // column number, starting at 1 (byte count)
+}
+
+// IsValid reports whether the position is valid.
+func (pos *Position) IsValid() bool {
+	return pos.Line > 0
+}
+
+func (pos Position) String() string {
+	s := pos.Filename
+	if pos.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
+}
+
+// File holds the source and line-offset table for one scanned file
+// within a FileSet.
+type File struct {
+	set  *FileSet
+	name string
+	base int // Pos value range for this file is [base, base+size]
+	size int
+
+	mutex sync.Mutex
+	lines []int // lines[i] is the offset of the first character of line i+2
+}
+
+// Name returns the file name.
+func (f *File) Name() string {
+	return f.name
+}
+
+// Base returns the base offset of file f, as registered with AddFile.
+func (f *File) Base() int {
+	return f.base
+}
+
+// Size returns the size of file f, as registered with AddFile.
+func (f *File) Size() int {
+	return f.size
+}
+
+// AddLine records the offset of the start of a new line. Offsets must
+// be added in increasing order, past the offset of every line already
+// recorded.
+func (f *File) AddLine(offset int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if n := len(f.lines); (n == 0 || f.lines[n-1] < offset) && offset < f.size {
+		f.lines = append(f.lines, offset)
+	}
+}
+
+// LineCount returns the number of lines recorded so far.
+func (f *File) LineCount() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.lines)
+}
+
+// Pos returns the Pos value for the given file offset.
+func (f *File) Pos(offset int) Pos {
+	if offset > f.size {
+		panic("illegal file offset")
+	}
+	return Pos(f.base + offset)
+}
+
+// Offset returns the offset for the given file Pos.
+func (f *File) Offset(pos Pos) int {
+	offset := int(pos) - f.base
+	if offset < 0 || offset > f.size {
+		panic("illegal Pos value")
+	}
+	return offset
+}
+
+// line returns the 1-based line number containing offset, using a
+// binary search over the recorded line-start table. lines[i] holds the
+// start offset of line i+2, since line 1 always starts at offset 0 and
+// is never recorded.
+func (f *File) line(offset int) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > offset }) + 1
+}
+
+// Position returns the Position value for the given file Pos.
+func (f *File) Position(pos Pos) Position {
+	offset := f.Offset(pos)
+	line := f.line(offset)
+
+	column := offset
+	if line >= 2 {
+		column = offset - f.lines[line-2]
+	}
+
+	return Position{
+		Filename: f.name,
+		Offset:   offset,
+		Line:     line,
+		Column:   column + 1,
+	}
+}
+
+// FileSet represents a set of source files. Positions from files added
+// to the same FileSet are comparable, since each File is assigned a
+// unique, non-overlapping range of Pos values.
+type FileSet struct {
+	mutex sync.Mutex
+	base  int
+	files []*File
+}
+
+// NewFileSet creates a new, empty FileSet.
+func NewFileSet() *FileSet {
+	return &FileSet{base: 1}
+}
+
+// AddFile adds a new file of the given name and size to the FileSet and
+// returns it. Multiple files may be added; each occupies a disjoint
+// range of Pos values so positions from different files never collide.
+func (s *FileSet) AddFile(filename string, size int) *File {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	base := s.base
+	file := &File{
+		set:  s,
+		name: filename,
+		base: base,
+		size: size,
+	}
+	s.base += size + 1 // +1 so the last line's terminating EOF gets its own Pos
+	s.files = append(s.files, file)
+	return file
+}
+
+// File returns the file that contains pos, or nil if pos is not owned
+// by any file in the set.
+func (s *FileSet) File(pos Pos) *File {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := sort.Search(len(s.files), func(i int) bool { return s.files[i].base > int(pos) }) - 1
+	if i < 0 || int(pos) > s.files[i].base+s.files[i].size {
+		return nil
+	}
+	return s.files[i]
+}
+
+// Position converts a Pos into a Position, resolving it against the
+// file that owns it.
+func (s *FileSet) Position(pos Pos) Position {
+	if pos == NoPos {
+		return Position{}
+	}
+	if file := s.File(pos); file != nil {
+		return file.Position(pos)
+	}
+	return Position{}
+}
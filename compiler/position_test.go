@@ -0,0 +1,39 @@
+package compiler
+
+import "testing"
+
+// TestFilePositionLines scans a multi-line source and checks that every
+// token's resolved Position reports the line it actually appears on,
+// starting at 1 for the first line.
+func TestFilePositionLines(t *testing.T) {
+	const src = "abc\ndef\nghi"
+	fset := NewFileSet()
+	file := fset.AddFile("lines.panda", len(src))
+	scanner := NewScanner(file, []byte(src), nil, false, nil)
+
+	wantLines := []int{1, 2, 3}
+	var gotLines []int
+	for {
+		pos, token, literal := scanner.Scan()
+		if token == EOF {
+			break
+		}
+		if token != IDENT {
+			continue
+		}
+		position := file.Position(pos)
+		if !position.IsValid() {
+			t.Fatalf("Position(%q) = %v, want a valid position", literal, position)
+		}
+		gotLines = append(gotLines, position.Line)
+	}
+
+	if len(gotLines) != len(wantLines) {
+		t.Fatalf("got %d identifier lines %v, want %v", len(gotLines), gotLines, wantLines)
+	}
+	for i, want := range wantLines {
+		if gotLines[i] != want {
+			t.Errorf("identifier %d: Line = %d, want %d", i, gotLines[i], want)
+		}
+	}
+}
@@ -16,41 +16,44 @@ type ErrorHandler func(position Position, msg string)
 type Scanner struct {
 	file *File
 	dir  string
-	src  []byte
+	src  source
 
 	err        ErrorHandler
 	ErrorCount int // total errors
 
 	scanComments bool
 	flags        map[string]bool // flags for condition compiler
-	flagStarted  bool            // if #if is true
-
-	char       rune
-	offset     int
-	readOffset int
-	lineOffset int
+	condStack    []condFrame     // nested #if/#elif/#else frames
+
+	insertSemi bool // insert a semicolon before next newline
+
+	// interpolated string state: stringStack holds one '{' nesting
+	// counter per currently-open "${...}" expression, so a literal '{'
+	// inside the expression (e.g. a map literal) doesn't prematurely
+	// close it. pendingInterpStart/resumeString drive Scan() through
+	// the INTERP_EXPR_START token and back into string-segment scanning
+	// once the matching '}' is seen at depth 0.
+	stringStack        []int
+	pendingInterpStart bool
+	resumeString       bool
 }
 
 // NewScanner return an initialized scanner
 func NewScanner(file *File, src []byte, err ErrorHandler, scanComment bool, flags []string) *Scanner {
 	scanner := &Scanner{}
 
-	//if file.size != len(src) {
-	//panic(fmt.Sprintf("file size (%d) does not match src len (%d)", file.size, len(src)))
-	//}
+	if file.Size() != len(src) {
+		panic(fmt.Sprintf("file size (%d) does not match src len (%d)", file.Size(), len(src)))
+	}
 	scanner.file = file
-	scanner.src = src
+	scanner.src.init(src)
 	scanner.err = err
 	scanner.scanComments = scanComment
 	//scanner.dir, _ = filepath.Split(file.name)
 
-	scanner.char = ' '
-	scanner.offset = 0
-	scanner.readOffset = 0
 	scanner.ErrorCount = 0
 
-	scanner.next()
-	if scanner.char == bom {
+	if scanner.src.ch == bom {
 		scanner.next()
 	}
 
@@ -62,74 +65,55 @@ func NewScanner(file *File, src []byte, err ErrorHandler, scanComment bool, flag
 	return scanner
 }
 
+// next advances to the next rune, validating it and updating the line
+// table for the one just consumed.
 func (s *Scanner) next() {
-	if s.readOffset < len(s.src) {
-		s.offset = s.readOffset
-		if s.char == '\n' {
-			//s.file.AddLine(s.offset)
-		}
-		r, w := rune(s.src[s.readOffset]), 1
-		switch {
-		case r == 0:
-			s.error(s.offset, "illegal character NUL")
-		case r >= utf8.RuneSelf:
-			// not ASCII
-			r, w = utf8.DecodeRune(s.src[s.readOffset:])
-			if r == utf8.RuneError && w == 1 {
-				s.error(s.offset, "illegal UTF-8 encoding")
-			} else if r == bom && s.offset > 0 {
-				s.error(s.offset, "illegal byte order mark")
-			}
-		}
-		s.readOffset += w
-		s.char = r
-	} else {
-		s.offset = len(s.src)
-		if s.char == '\n' {
-			//s.file.AddLine(s.offset)
-		}
-		s.char = eof
+	if s.src.ch == '\n' {
+		s.file.AddLine(s.src.b)
+	}
+	s.src.nextch()
+	offset := s.src.offset()
+	switch {
+	case s.src.ch == 0:
+		s.error(offset, "illegal character NUL")
+	case s.src.ch == utf8.RuneError && s.src.chw == 1:
+		s.error(offset, "illegal UTF-8 encoding")
+	case s.src.ch == bom && offset > 0:
+		s.error(offset, "illegal byte order mark")
 	}
 }
 
 func (s *Scanner) peek() byte {
-	if s.readOffset < len(s.src) {
-		return s.src[s.readOffset]
-	}
-	return 0
+	return s.src.peek()
 }
 
 func (s *Scanner) error(offset int, msg string) {
-	fmt.Println("error:", msg)
 	if s.err != nil {
-		//s.err(s.file.Position(s.file.Pos(offset)), msg)
+		s.err(s.file.Position(s.file.Pos(offset)), msg)
 	}
 	s.ErrorCount++
 }
 
 func (s *Scanner) scanComment() string {
-	// initial '/' already consumed; s.ch == '/' || s.ch == '*'
-	offset := s.offset - 1 // position of initial '/'
+	// initial '/' already consumed; s.src.ch == '/' || s.src.ch == '*'
+	offset := s.src.offset() - 1 // position of initial '/'
+	s.src.startLitAt(offset)
 
-	if s.char == '/' {
+	if s.src.ch == '/' {
 		//-style comment
 		// (the final '\n' is not considered part of the comment)
 		s.next()
-		for s.char != '\n' && s.char >= 0 {
+		for s.src.ch != '\n' && s.src.ch >= 0 {
 			s.next()
 		}
-		// if we are at '\n', the position following the comment is afterwards
-		if s.char == '\n' {
-			//TO-DO update line info
-		}
 	} else {
 		/*-style comment */
 		terminated := false
 		s.next()
-		for s.char >= 0 {
-			char := s.char
+		for s.src.ch >= 0 {
+			char := s.src.ch
 			s.next()
-			if char == '*' && s.char == '/' {
+			if char == '*' && s.src.ch == '/' {
 				s.next()
 				terminated = true
 				break
@@ -139,82 +123,143 @@ func (s *Scanner) scanComment() string {
 			s.error(offset, "comment not terminated")
 		}
 	}
-	return string(s.src[offset:s.offset])
+	return string(s.src.stopLit())
 }
 
 func (s *Scanner) scanIdentifier() string {
-	offset := s.offset
-	for s.isLetter(s.char) || s.isDecimal(s.char) {
+	s.src.startLit()
+	for s.isLetter(s.src.ch) || s.isDecimal(s.src.ch) {
 		s.next()
 	}
-	return string(s.src[offset:s.offset])
+	return string(s.src.stopLit())
 }
 
-func (s *Scanner) scanDigits(base int) {
-	for s.digitVal(s.char) < base {
+// numberSuffixes is the set of recognized trailing type suffixes. The
+// scanner only recognizes and includes them in the literal text; a
+// later semantic pass strips and honors them.
+var numberSuffixes = map[string]bool{
+	"i8": true, "i16": true, "i32": true, "i64": true,
+	"u8": true, "u16": true, "u32": true, "u64": true,
+	"f32": true, "f64": true,
+}
+
+// digits scans a run of base-digits, accepting a single '_' between two
+// digits as a separator, and reports whether at least one digit was
+// found. A '_' not immediately preceded and followed by a valid digit of
+// this base -- leading, trailing, or doubled -- is reported as an error.
+func (s *Scanner) digits(base int) bool {
+	ok := false
+	for {
+		if s.src.ch == '_' {
+			bad := !ok
+			s.next()
+			if s.digitVal(s.src.ch) >= base {
+				bad = true
+			}
+			if bad {
+				s.error(s.src.offset(), "'_' must separate successive digits")
+			}
+			continue
+		}
+		if s.digitVal(s.src.ch) >= base {
+			break
+		}
+		ok = true
 		s.next()
 	}
+	return ok
 }
 
+// scanNumber scans an integer or floating-point literal: decimal, hex
+// ("0x"), octal ("0o") or binary ("0b") integers; decimal floats with an
+// "e"/"E" exponent and hex floats with a "p"/"P" exponent (e.g.
+// "0x1.Fp10"); '_' digit separators in any base; and an optional
+// trailing type suffix (i8, u32, f64, ...).
 func (s *Scanner) scanNumber() (Token, string) {
-	offset := s.offset
+	s.src.startLit()
+	offset := s.src.offset()
 	token := INT
+	base := 10
+	hex := false
 
-	if s.char != '.' {
-		if s.char == '0' {
+	if s.src.ch != '.' {
+		if s.src.ch == '0' {
 			s.next()
-			if s.char != '.' {
-				base := 10
-				switch s.lower(s.char) {
-				case 'x':
-					base = 16
-				case 'b':
-					base = 2
-				case 'o':
-					base = 8
-				default:
-					s.error(offset, "invalid integer")
+			switch s.lower(s.src.ch) {
+			case 'x':
+				s.next()
+				base, hex = 16, true
+			case 'o':
+				s.next()
+				base = 8
+			case 'b':
+				s.next()
+				base = 2
+			case '.':
+				// "0." is scanned as a float below
+			default:
+				if s.isDecimal(s.src.ch) {
+					s.error(offset, "invalid integer: leading zero, use '0o' for octal")
 					token = ILLEGAL
 				}
-				if token != ILLEGAL {
-					s.next()
-					s.scanDigits(base)
-					if s.offset-offset <= 2 {
-						// only scanned "0x" or "0X"
-						token = ILLEGAL
-						s.error(offset, "illegal number")
-					}
-					if s.char == '.' {
-						token = ILLEGAL
-						s.error(offset, "invalid radix point")
-					}
-				}
+			}
+			if base != 10 && !s.digits(base) {
+				s.error(offset, "illegal number: no digits after base prefix")
+				token = ILLEGAL
 			}
 		} else {
-			s.scanDigits(10)
+			s.digits(10)
 		}
 	}
 
-	if s.char == '.' {
-		offsetFraction := s.offset
+	if s.src.ch == '.' {
+		if base != 10 && !hex {
+			s.error(offset, "invalid radix point")
+			token = ILLEGAL
+		}
 		token = FLOAT
 		s.next()
-		s.scanDigits(10)
-		if offsetFraction == s.offset-1 {
+		s.digits(base)
+	}
+
+	if e := s.lower(s.src.ch); (e == 'e' && base == 10) || (e == 'p' && hex) {
+		s.next()
+		token = FLOAT
+		if s.src.ch == '+' || s.src.ch == '-' {
+			s.next()
+		}
+		if !s.digits(10) {
+			s.error(offset, "exponent has no digits")
 			token = ILLEGAL
-			s.error(offset, "float has no digits after .")
 		}
+	} else if hex && token == FLOAT {
+		s.error(offset, "hexadecimal mantissa requires a 'p' exponent")
+		token = ILLEGAL
 	}
 
-	return token, string(s.src[offset:s.offset])
+	if s.isLetter(s.src.ch) {
+		suffixStart := s.src.offset()
+		for s.isLetter(s.src.ch) || s.isDecimal(s.src.ch) {
+			s.next()
+		}
+		suffix := string(s.src.segment()[suffixStart-offset:])
+		if !numberSuffixes[suffix] {
+			s.error(suffixStart, "invalid number suffix '"+suffix+"'")
+			token = ILLEGAL
+		} else if suffix[0] == 'f' {
+			token = FLOAT
+		}
+	}
+
+	return token, string(s.src.stopLit())
 }
 
 func (s *Scanner) scanEscape(quote rune) bool {
-	offset := s.offset
+	offset := s.src.offset()
 
 	var n int
 	var base, max uint32
-	switch s.char {
+	switch s.src.ch {
 	case 'a', 'b', 'f', 'n', 'r', 't', 'v', '\\', quote:
 		s.next()
 		return true
@@ -231,7 +276,7 @@ func (s *Scanner) scanEscape(quote rune) bool {
 		n, base, max = 8, 16, unicode.MaxRune
 	default:
 		msg := "unknown escape sequence"
-		if s.char < 0 {
+		if s.src.ch < 0 {
 			msg = "escape sequence not terminated"
 		}
 		s.error(offset, msg)
@@ -240,13 +285,13 @@ func (s *Scanner) scanEscape(quote rune) bool {
 
 	var x uint32
 	for n > 0 {
-		d := uint32(s.digitVal(s.char))
+		d := uint32(s.digitVal(s.src.ch))
 		if d >= base {
-			msg := fmt.Sprintf("illegal character %#U in escape sequence", s.char)
-			if s.char < 0 {
+			msg := fmt.Sprintf("illegal character %#U in escape sequence", s.src.ch)
+			if s.src.ch < 0 {
 				msg = "escape sequence not terminated"
 			}
-			s.error(s.offset, msg)
+			s.error(s.src.offset(), msg)
 			return false
 		}
 		x = x*base + d
@@ -262,15 +307,38 @@ func (s *Scanner) scanEscape(quote rune) bool {
 	return true
 }
 
-func (s *Scanner) scanString() string {
-	offset := s.offset - 1
+// scanStringSegment scans one literal run of a (possibly interpolated)
+// double-quoted string: from the opening quote (isFirst) or from just
+// after a "}" that closed an interpolated expression, up to the closing
+// quote or the next "${" ('$' has no escape sequence, so a "${" inside
+// a double-quoted string always opens an interpolation). An interpolation
+// pushes a new frame onto s.stringStack and returns a *_START/*_MID
+// token; the caller is expected to continue with an INTERP_EXPR_START
+// token before resuming normal scanning of the expression.
+func (s *Scanner) scanStringSegment(isFirst bool) (Token, string) {
+	offset := s.src.offset()
+	if isFirst {
+		offset--
+	}
+	s.src.startLitAt(offset)
 
 	for {
-		char := s.char
+		char := s.src.ch
 		if char == '\n' || char < 0 {
 			s.error(offset, "string literal not terminated")
 			break
 		}
+		if char == '$' && s.peek() == '{' {
+			literal := string(s.src.stopLit())
+			s.next() // '$'
+			s.next() // '{'
+			s.stringStack = append(s.stringStack, 0)
+			s.pendingInterpStart = true
+			if isFirst {
+				return STRING_START, literal
+			}
+			return STRING_MID, literal
+		}
 		s.next()
 		if char == '"' {
 			break
@@ -280,17 +348,22 @@ func (s *Scanner) scanString() string {
 		}
 	}
 
-	return string(s.src[offset:s.offset])
+	literal := string(s.src.stopLit())
+	if isFirst {
+		return STRING, literal
+	}
+	return STRING_END, literal
 }
 
 func (s *Scanner) scanChar() string {
 	// '\'' opening already consumed
-	offset := s.offset - 1
+	offset := s.src.offset() - 1
+	s.src.startLitAt(offset)
 
 	valid := true
 	n := 0
 	for {
-		char := s.char
+		char := s.src.ch
 		if char == '\n' || char < 0 {
 			if valid {
 				s.error(offset, "rune literal not terminated")
@@ -304,7 +377,7 @@ func (s *Scanner) scanChar() string {
 		}
 		n++
 		if char == '\\' {
-			switch s.char {
+			switch s.src.ch {
 			case 'a', 'b', 'f', 'n', 'r', 't', 'v', '\\', '\'':
 				s.next()
 			default:
@@ -318,14 +391,15 @@ func (s *Scanner) scanChar() string {
 		s.error(offset, "illegal char literal")
 	}
 
-	return string(s.src[offset:s.offset])
+	return string(s.src.stopLit())
 }
 
 func (s *Scanner) scanRawString() string {
 	// '`' opening already consumed
-	offset := s.offset - 1
+	offset := s.src.offset() - 1
+	s.src.startLitAt(offset)
 	for {
-		char := s.char
+		char := s.src.ch
 		if char < 0 {
 			s.error(offset, "raw string literal not terminated")
 			break
@@ -335,63 +409,303 @@ func (s *Scanner) scanRawString() string {
 			break
 		}
 	}
-	return string(s.src[offset:s.offset])
+	return string(s.src.stopLit())
 }
 
-/*
-func (s *Scanner) scanOperators(char rune) (rune, Token) {
-	// TO-DO optimization later with tree, and opt info stored in scanner
-	for HasToken(s.currentToken() + string(char)) {
-		char = s.next()
+// switch2 peeks at most one char ahead: '=' selects tok1, otherwise tok0.
+func (s *Scanner) switch2(tok0, tok1 Token) Token {
+	if s.src.ch == '=' {
+		s.next()
+		return tok1
 	}
-	return char, KeyToToken(s.currentToken())
-}*/
+	return tok0
+}
 
-/*
-func (s *Scanner) scanPreprossesor() (rune, bool) {
-	char := s.next()
-	notOp := false
-	if char == '!' {
-		notOp = true
-		char = s.next()
+// switch3 is switch2 plus a second candidate second-char ch2 -> tok2.
+func (s *Scanner) switch3(tok0, tok1 Token, ch2 rune, tok2 Token) Token {
+	if s.src.ch == '=' {
+		s.next()
+		return tok1
 	}
-	s.resetToken()
-	if !s.isIdentifierRune(char, 0) {
-		s.error(fmt.Sprintf("unexpected %s \n", string(char)))
+	if s.src.ch == ch2 {
+		s.next()
+		return tok2
 	}
-	char = s.scanIdentifier()
-	for char == ' ' || char == '\t' || char == '\r' {
-		char = s.next()
+	return tok0
+}
+
+// switch4 is switch3 plus a trailing '=' on the ch2 branch -> tok3.
+func (s *Scanner) switch4(tok0, tok1 Token, ch2 rune, tok2, tok3 Token) Token {
+	if s.src.ch == '=' {
+		s.next()
+		return tok1
 	}
-	if char != '\n' {
-		s.error("unexpected " + string(char))
+	if s.src.ch == ch2 {
+		s.next()
+		if s.src.ch == '=' {
+			s.next()
+			return tok3
+		}
+		return tok2
 	}
-	result := false
-	text := s.currentToken()
-	if _, ok := s.flags[text]; ok {
-		result = true
+	return tok0
+}
+
+// condFrame tracks one level of #if/#elif/#else/#end nesting.
+type condFrame struct {
+	active  bool // the current branch of this frame is emitting tokens
+	matched bool // some branch of this frame has already been taken
+}
+
+// condActive reports whether the innermost #if frame (if any) is
+// currently emitting tokens.
+func (s *Scanner) condActive() bool {
+	if len(s.condStack) == 0 {
+		return true
 	}
-	if notOp {
-		result = !result
+	return s.condStack[len(s.condStack)-1].active
+}
+
+// outerCondActive reports whether the frame enclosing the innermost one
+// is active, i.e. whether the innermost frame could possibly emit
+// tokens at all.
+func (s *Scanner) outerCondActive() bool {
+	if len(s.condStack) < 2 {
+		return true
 	}
-	return char, result
+	return s.condStack[len(s.condStack)-2].active
 }
 
-func (s *Scanner) skipPreprossesor() rune {
-	char, _ := s.scanUntil('#')
-	char = s.next()
-	if s.isIdentifierRune(char, 0) {
-		s.resetToken()
-		char = s.scanIdentifier()
-		text := s.currentToken()
-		if text != "end" {
-			s.error(fmt.Sprintf("unexpected: %s" + text))
+// scanDirective scans a '#if'/'#elif'/'#else'/'#end' directive (the
+// leading '#' has already been consumed) and, if it leaves the scanner
+// inside an inactive branch, skips source text until a directive that
+// reactivates it or closes it.
+func (s *Scanner) scanDirective() {
+	if !s.isLetter(s.src.ch) {
+		s.error(s.src.offset(), "expected directive name after '#'")
+		return
+	}
+	s.handleDirective(s.scanIdentifier())
+	for !s.condActive() {
+		if !s.seekNextDirective() {
+			return
 		}
-	} else {
-		s.error("unexpected: " + string(char))
 	}
-	return char
-}*/
+}
+
+// handleDirective updates the condition stack for one named directive.
+// For "if"/"elif" it also consumes and evaluates the expression that
+// follows on the same line, but only when the branch could possibly
+// become active; an inactive outer frame makes the expression's flags
+// meaningless, so it is left unread for seekNextDirective to skip.
+func (s *Scanner) handleDirective(name string) {
+	switch name {
+	case "if":
+		active := s.condActive()
+		result := active && s.evalCondExpr()
+		s.condStack = append(s.condStack, condFrame{active: result, matched: result})
+	case "elif":
+		if len(s.condStack) == 0 {
+			s.error(s.src.offset(), "#elif without matching #if")
+			return
+		}
+		top := &s.condStack[len(s.condStack)-1]
+		if top.matched || !s.outerCondActive() {
+			top.active = false
+		} else {
+			result := s.evalCondExpr()
+			top.active = result
+			top.matched = result
+		}
+	case "else":
+		if len(s.condStack) == 0 {
+			s.error(s.src.offset(), "#else without matching #if")
+			return
+		}
+		top := &s.condStack[len(s.condStack)-1]
+		top.active = s.outerCondActive() && !top.matched
+		top.matched = true
+	case "end":
+		if len(s.condStack) == 0 {
+			s.error(s.src.offset(), "#end without matching #if")
+			return
+		}
+		s.condStack = s.condStack[:len(s.condStack)-1]
+	default:
+		s.error(s.src.offset(), "unknown directive #"+name)
+	}
+}
+
+// seekNextDirective discards source text until it finds the
+// #elif/#else/#end that closes the current (inactive) frame. Nested
+// #if/#end pairs encountered along the way are only depth-counted, not
+// pushed onto condStack, since their contents are inactive either way.
+// It returns false, after reporting an error, if EOF is reached first.
+func (s *Scanner) seekNextDirective() bool {
+	depth := 0
+	for {
+		if s.src.ch == eof {
+			s.error(s.src.offset(), "#if not terminated, expecting #end")
+			return false
+		}
+		if s.src.ch != '#' {
+			s.next()
+			continue
+		}
+		s.next()
+		if !s.isLetter(s.src.ch) {
+			continue
+		}
+		name := s.scanIdentifier()
+		switch name {
+		case "if":
+			depth++
+		case "elif", "else":
+			if depth == 0 {
+				s.handleDirective(name)
+				return true
+			}
+		case "end":
+			if depth == 0 {
+				s.handleDirective(name)
+				return true
+			}
+			depth--
+		}
+	}
+}
+
+// condToken is the token kind produced by the #if expression
+// mini-tokenizer; it only needs to distinguish the handful of forms
+// that expression grammar uses.
+type condToken int
+
+const (
+	condEOL condToken = iota
+	condIdent
+	condNot
+	condAnd
+	condOr
+	condLParen
+	condRParen
+)
+
+// nextCondToken scans one token of a #if/#elif expression directly off
+// the scanner's rune stream, stopping at the end of the line.
+func (s *Scanner) nextCondToken() (condToken, string) {
+	for s.src.ch == ' ' || s.src.ch == '\t' || s.src.ch == '\r' {
+		s.next()
+	}
+	switch {
+	case s.src.ch == '\n' || s.src.ch == eof:
+		return condEOL, ""
+	case s.isLetter(s.src.ch):
+		return condIdent, s.scanIdentifier()
+	case s.src.ch == '!':
+		s.next()
+		return condNot, "!"
+	case s.src.ch == '&':
+		s.next()
+		if s.src.ch == '&' {
+			s.next()
+			return condAnd, "&&"
+		}
+		s.error(s.src.offset(), "expected '&&' in #if expression")
+		return condEOL, ""
+	case s.src.ch == '|':
+		s.next()
+		if s.src.ch == '|' {
+			s.next()
+			return condOr, "||"
+		}
+		s.error(s.src.offset(), "expected '||' in #if expression")
+		return condEOL, ""
+	case s.src.ch == '(':
+		s.next()
+		return condLParen, "("
+	case s.src.ch == ')':
+		s.next()
+		return condRParen, ")"
+	}
+	s.error(s.src.offset(), fmt.Sprintf("unexpected character %#U in #if expression", s.src.ch))
+	s.next()
+	return condEOL, ""
+}
+
+// evalCondExpr is a small Pratt-style parser/evaluator for #if/#elif
+// expressions: identifier flags, defined(flag), !, && and || with
+// parenthesization. It consumes tokens through end of line.
+func (s *Scanner) evalCondExpr() bool {
+	tok, lit := s.nextCondToken()
+	result := s.evalCondOr(&tok, &lit)
+	if tok != condEOL {
+		s.error(s.src.offset(), "unexpected trailing tokens in #if expression")
+	}
+	return result
+}
+
+func (s *Scanner) evalCondOr(tok *condToken, lit *string) bool {
+	result := s.evalCondAnd(tok, lit)
+	for *tok == condOr {
+		*tok, *lit = s.nextCondToken()
+		rhs := s.evalCondAnd(tok, lit)
+		result = result || rhs
+	}
+	return result
+}
+
+func (s *Scanner) evalCondAnd(tok *condToken, lit *string) bool {
+	result := s.evalCondUnary(tok, lit)
+	for *tok == condAnd {
+		*tok, *lit = s.nextCondToken()
+		rhs := s.evalCondUnary(tok, lit)
+		result = result && rhs
+	}
+	return result
+}
+
+func (s *Scanner) evalCondUnary(tok *condToken, lit *string) bool {
+	if *tok == condNot {
+		*tok, *lit = s.nextCondToken()
+		return !s.evalCondUnary(tok, lit)
+	}
+	return s.evalCondPrimary(tok, lit)
+}
+
+func (s *Scanner) evalCondPrimary(tok *condToken, lit *string) bool {
+	switch *tok {
+	case condIdent:
+		name := *lit
+		*tok, *lit = s.nextCondToken()
+		if name == "defined" && *tok == condLParen {
+			*tok, *lit = s.nextCondToken()
+			if *tok != condIdent {
+				s.error(s.src.offset(), "expected flag name after 'defined('")
+				return false
+			}
+			flag := *lit
+			*tok, *lit = s.nextCondToken()
+			if *tok != condRParen {
+				s.error(s.src.offset(), "expected ')' after 'defined(...'")
+			} else {
+				*tok, *lit = s.nextCondToken()
+			}
+			return s.flags[flag]
+		}
+		return s.flags[name]
+	case condLParen:
+		*tok, *lit = s.nextCondToken()
+		result := s.evalCondOr(tok, lit)
+		if *tok != condRParen {
+			s.error(s.src.offset(), "expected ')'")
+		} else {
+			*tok, *lit = s.nextCondToken()
+		}
+		return result
+	}
+	s.error(s.src.offset(), "expected identifier or '(' in #if expression")
+	return false
+}
 
 func (s *Scanner) isLetter(char rune) bool {
 	return char == '_' || 'a' <= char && char <= 'z' || 'A' <= char && char <= 'Z'
@@ -417,113 +731,180 @@ func (s *Scanner) digitVal(char rune) int {
 	return 16 // larger than any legal digit val
 }
 
-// Scan next token
-func (s *Scanner) Scan() (pos Position, token Token, literal string) {
-	for s.char == ' ' || s.char == '\t' || s.char == '\n' || s.char == '\r' {
+// skipWhitespace skips spaces, tabs and carriage returns, and newlines
+// as long as no automatic semicolon is pending on this one.
+func (s *Scanner) skipWhitespace() {
+	for s.src.ch == ' ' || s.src.ch == '\t' || s.src.ch == '\r' || (s.src.ch == '\n' && !s.insertSemi) {
 		s.next()
 	}
+}
 
-	//pos = s.file.Pos(s.offset)
+// Scan next token
+func (s *Scanner) Scan() (pos Pos, token Token, literal string) {
+	if s.pendingInterpStart {
+		s.pendingInterpStart = false
+		s.insertSemi = false
+		return s.file.Pos(s.src.offset()), INTERP_EXPR_START, ""
+	}
+	if s.resumeString {
+		s.resumeString = false
+		pos = s.file.Pos(s.src.offset())
+		token, literal = s.scanStringSegment(false)
+		s.insertSemi = token.canEndStatement()
+		return
+	}
 
+	s.skipWhitespace()
+
+	pos = s.file.Pos(s.src.offset())
+
+	insertSemi := false
 	token = ILLEGAL
-	if s.isLetter(s.char) {
+	if s.isLetter(s.src.ch) {
 		literal = s.scanIdentifier()
 		token = Lookup(literal)
-	} else if s.isDecimal(s.char) || (s.char == '.' && s.isDecimal(rune(s.peek()))) {
+		insertSemi = token.canEndStatement()
+	} else if s.isDecimal(s.src.ch) || (s.src.ch == '.' && s.isDecimal(rune(s.peek()))) {
 		token, literal = s.scanNumber()
+		insertSemi = true
 	} else {
-		char := s.char
+		char := s.src.ch
 		s.next()
 		switch char {
+		case '\n':
+			// only reached when s.insertSemi caused skipWhitespace to
+			// stop right before the newline
+			s.insertSemi = false
+			return pos, SEMICOLON, "\n"
 		case eof:
+			if s.insertSemi {
+				s.insertSemi = false
+				return pos, SEMICOLON, "\n"
+			}
 			token = EOF
-			/*
-				if s.conditionStarted {
-					s.error("#if not terminated, expecting #end")
-				}*/
+			if len(s.condStack) > 0 {
+				s.error(s.src.offset(), "#if not terminated, expecting #end")
+			}
+			if len(s.stringStack) > 0 {
+				s.error(s.src.offset(), "string literal not terminated")
+			}
 		case '"':
-			token = STRING
-			literal = s.scanString()
+			token, literal = s.scanStringSegment(true)
+			insertSemi = token.canEndStatement()
 		case '`':
 			token = STRING
 			literal = s.scanRawString()
+			insertSemi = true
 		case '\'':
 			token = CHAR
 			literal = s.scanChar()
-		case '.': //start with . can maybe operator
-			//token, literal = s.scanOperators()
-			/*
-			   case '/':
-			   			if s.ch == '/' || s.ch == '*' {
-			   			} else {
-			   				tok = s.switch2(token.QUO, token.QUO_ASSIGN)
-			   			}
-			*/
-		case '/': // alse maybe operator /
-			if s.char == '/' || s.char == '*' {
+			insertSemi = true
+		case '.':
+			token = PERIOD
+			if s.src.ch == '.' {
+				s.next()
+				if s.src.ch == '.' {
+					s.next()
+					token = ELLIPSIS
+				} else {
+					token = RANGE
+				}
+			}
+		case '/':
+			if s.src.ch == '/' || s.src.ch == '*' {
 				literal = s.scanComment()
 				if !s.scanComments {
 					return s.Scan()
 				}
+				// a comment never itself ends a statement, but it
+				// must not clear a semicolon insertion pending from
+				// before the comment (e.g. "x // trailing\n")
+				insertSemi = s.insertSemi
 				token = COMMENT
 			} else {
-				//token, literal = s.scanOperators()
+				token = s.switch2(QUO, QUO_ASSIGN)
+			}
+		case ',':
+			token = COMMA
+		case ';':
+			token = SEMICOLON
+			literal = ";"
+		case '(':
+			token = LPAREN
+		case ')':
+			token = RPAREN
+			insertSemi = true
+		case '[':
+			token = LBRACK
+		case ']':
+			token = RBRACK
+			insertSemi = true
+		case '{':
+			if n := len(s.stringStack); n > 0 {
+				s.stringStack[n-1]++
 			}
+			token = LBRACE
+		case '}':
+			if n := len(s.stringStack); n > 0 && s.stringStack[n-1] == 0 {
+				s.stringStack = s.stringStack[:n-1]
+				s.resumeString = true
+				s.insertSemi = false
+				return pos, INTERP_EXPR_END, "}"
+			} else if n > 0 {
+				s.stringStack[n-1]--
+				token = RBRACE
+				insertSemi = true
+			} else {
+				token = RBRACE
+				insertSemi = true
+			}
+		case ':':
+			token = s.switch2(COLON, DEFINE)
+		case '+':
+			token = s.switch3(ADD, ADD_ASSIGN, '+', INC)
+			insertSemi = token == INC
+		case '-':
+			token = s.switch3(SUB, SUB_ASSIGN, '-', DEC)
+			insertSemi = token == DEC
+		case '*':
+			token = s.switch2(MUL, MUL_ASSIGN)
+		case '%':
+			token = s.switch2(REM, REM_ASSIGN)
+		case '^':
+			token = s.switch2(XOR, XOR_ASSIGN)
+		case '<':
+			token = s.switch4(LSS, LEQ, '<', SHL, SHL_ASSIGN)
+		case '>':
+			token = s.switch4(GTR, GEQ, '>', SHR, SHR_ASSIGN)
+		case '=':
+			token = s.switch2(ASSIGN, EQL)
+		case '!':
+			token = s.switch2(NOT, NEQ)
+		case '&':
+			if s.src.ch == '^' {
+				s.next()
+				token = s.switch2(AND_NOT, AND_NOT_ASSIGN)
+			} else {
+				token = s.switch3(AND, AND_ASSIGN, '&', LAND)
+			}
+		case '|':
+			token = s.switch3(OR, OR_ASSIGN, '|', LOR)
 		case '@':
-			if s.isLetter(s.char) {
+			if s.isLetter(s.src.ch) {
 				token = META
 				literal = s.scanIdentifier()
+				insertSemi = true
 			} else {
-				s.error(s.offset, "invalid meta name")
+				s.error(s.src.offset(), "invalid meta name")
 			}
-			/*
-				case '#':
-					//#if #end, before flag can add '!' for not operation
-					//nested # is not supported
-					char = s.next()
-					if s.isIdentifierRune(char, 0) {
-						s.resetToken()
-						char = s.scanIdentifier()
-						text := s.currentToken()
-						if text == "if" {
-							if s.conditionStarted {
-								s.error("unexpected #if")
-							}
-							s.conditionStarted = true
-						} else if text == "end" {
-							if !s.conditionStarted {
-								s.error("unexpected #end")
-							}
-							s.conditionStarted = false
-						} else {
-							s.error("unexpected: " + text)
-						}
-
-						if text == "if" {
-							result := false
-							char, result = s.scanPreprossesor()
-							if !result {
-								char = s.skipPreprossesor()
-								char = s.next()
-								s.conditionStarted = false
-							}
-						}
-
-						s.char = char
-						return s.Scan()
-					}
-					s.error("unexpected: " + string(char))*/
+		case '#':
+			s.scanDirective()
+			return s.Scan()
 		default:
-			/*
-				if IsOperator(char) {
-					char = s.next()
-					char, token = s.scanOperators(char)
-				} else*/{
-				// invalid
-				s.error(s.offset, "invalid token")
-				s.next()
-			}
+			// invalid
+			s.error(s.src.offset(), "invalid token")
 		}
 	}
+	s.insertSemi = insertSemi
 	return
 }
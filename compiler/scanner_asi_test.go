@@ -0,0 +1,49 @@
+package compiler
+
+import "testing"
+
+// scanTokens scans src to EOF and returns the sequence of tokens produced.
+func scanTokens(src string) []Token {
+	fset := NewFileSet()
+	file := fset.AddFile("asi.panda", len(src))
+	scanner := NewScanner(file, []byte(src), nil, false, nil)
+	var tokens []Token
+	for {
+		_, token, _ := scanner.Scan()
+		tokens = append(tokens, token)
+		if token == EOF {
+			break
+		}
+	}
+	return tokens
+}
+
+func TestScanAutoSemicolonInsertion(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []Token
+	}{
+		// an identifier at the end of a line can end a statement, so a
+		// semicolon is inserted before the newline.
+		{"x\n", []Token{IDENT, SEMICOLON, EOF}},
+		// return is one of the keywords that can end a statement.
+		{"return x\n", []Token{RETURN, IDENT, SEMICOLON, EOF}},
+		// a trailing binary operator cannot end a statement, so no
+		// semicolon is inserted and the expression continues.
+		{"x +\ny\n", []Token{IDENT, ADD, IDENT, SEMICOLON, EOF}},
+		// a line ending in an opening brace never gets a semicolon.
+		{"x {\n", []Token{IDENT, LBRACE, EOF}},
+	}
+	for _, tt := range tests {
+		got := scanTokens(tt.src)
+		if len(got) != len(tt.want) {
+			t.Errorf("scanTokens(%q) = %v, want %v", tt.src, got, tt.want)
+			continue
+		}
+		for i, token := range got {
+			if token != tt.want[i] {
+				t.Errorf("scanTokens(%q)[%d] = %v, want %v", tt.src, i, token, tt.want[i])
+			}
+		}
+	}
+}
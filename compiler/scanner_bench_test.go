@@ -0,0 +1,57 @@
+package compiler
+
+import "testing"
+
+// benchSrc is representative panda source: identifiers, numbers, a
+// string with two interpolations, operators and a comment. Each benchmark
+// iteration scans it once to EOF.
+const benchSrc = `
+string name = "hello ${user.name}, you have ${count} messages"
+int total = 12345 + balance * 2 // running total
+if total >= 100 {
+	print(name)
+}
+`
+
+func newBenchScanner(b *testing.B, src string) *Scanner {
+	fset := NewFileSet()
+	file := fset.AddFile("bench.panda", len(src))
+	return NewScanner(file, []byte(src), nil, false, nil)
+}
+
+// BenchmarkScan exercises the rune-based source cursor against the
+// representative snippet above, scanning it to EOF. Only the current
+// scanner is measured; the byte-slice-based next()/peek() implementation
+// it replaced is not benchmarked here. Every Scan() call here produces its literal text as a slice into the source
+// buffer via startLit/stopLit rather than re-deriving it from stored
+// offsets, so no per-token []byte is allocated beyond the final string
+// conversion.
+func BenchmarkScan(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		scanner := newBenchScanner(b, benchSrc)
+		for {
+			_, token, _ := scanner.Scan()
+			if token == EOF {
+				break
+			}
+		}
+	}
+}
+
+// BenchmarkScanIdentifiers isolates identifier scanning, the hottest path
+// in most source files, to measure the cost of scanIdentifier's
+// startLit/stopLit pair in isolation from number/string scanning.
+func BenchmarkScanIdentifiers(b *testing.B) {
+	const src = "alpha beta gamma delta epsilon zeta eta theta iota kappa\n"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		scanner := newBenchScanner(b, src)
+		for {
+			_, token, _ := scanner.Scan()
+			if token == EOF {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package compiler
+
+import (
+	"reflect"
+	"testing"
+)
+
+// scanIdentifiers scans src with the given flags and returns the text of
+// every IDENT token produced, letting a test see which branches of a
+// preprocessor directive were emitted without caring about surrounding
+// semicolons or newlines.
+func scanIdentifiers(src string, flags ...string) []string {
+	fset := NewFileSet()
+	file := fset.AddFile("directive.panda", len(src))
+	scanner := NewScanner(file, []byte(src), nil, false, flags)
+	var idents []string
+	for {
+		_, token, literal := scanner.Scan()
+		if token == EOF {
+			break
+		}
+		if token == IDENT {
+			idents = append(idents, literal)
+		}
+	}
+	return idents
+}
+
+func TestScanDirectiveConditionalCompilation(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		flags []string
+		want  []string
+	}{
+		{
+			name:  "if true",
+			src:   "#if debug\nkept\n#end\n",
+			flags: []string{"debug"},
+			want:  []string{"kept"},
+		},
+		{
+			name: "if false",
+			src:  "#if debug\ndropped\n#end\n",
+			want: nil,
+		},
+		{
+			name: "if/else takes else",
+			src:  "#if debug\ndropped\n#else\nkept\n#end\n",
+			want: []string{"kept"},
+		},
+		{
+			name:  "if/elif/else takes elif",
+			src:   "#if a\ndropped1\n#elif b\nkept\n#else\ndropped2\n#end\n",
+			flags: []string{"b"},
+			want:  []string{"kept"},
+		},
+		{
+			name: "if/elif/else takes else when none match",
+			src:  "#if a\ndropped1\n#elif b\ndropped2\n#else\nkept\n#end\n",
+			want: []string{"kept"},
+		},
+		{
+			name:  "only first matching branch is taken",
+			src:   "#if a\nfirst\n#elif a\nsecond\n#end\n",
+			flags: []string{"a"},
+			want:  []string{"first"},
+		},
+		{
+			name:  "nested if inside an active branch",
+			src:   "#if outer\n#if inner\nkept\n#end\n#end\n",
+			flags: []string{"outer", "inner"},
+			want:  []string{"kept"},
+		},
+		{
+			name:  "nested if inside an inactive branch stays inactive",
+			src:   "#if outer\n#if inner\ndropped\n#end\n#end\n",
+			flags: []string{"inner"},
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scanIdentifiers(tt.src, tt.flags...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scanIdentifiers(%q, %v) = %v, want %v", tt.src, tt.flags, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanDirectiveErrors(t *testing.T) {
+	tests := []string{
+		"#elif a\n",
+		"#else\n",
+		"#end\n",
+		"#bogus\n",
+	}
+	for _, src := range tests {
+		if errs := scanAll(src); errs == 0 {
+			t.Errorf("scanAll(%q): want at least one error, got none", src)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package compiler
+
+import "testing"
+
+// scanOneNumber scans a single number literal from src and returns the
+// token, literal text, and number of errors reported.
+func scanOneNumber(src string) (Token, string, int) {
+	fset := NewFileSet()
+	file := fset.AddFile("number.panda", len(src))
+	var errs int
+	errHandler := func(Position, string) { errs++ }
+	scanner := NewScanner(file, []byte(src), errHandler, false, nil)
+	_, token, literal := scanner.Scan()
+	return token, literal, errs
+}
+
+func TestScanNumberValid(t *testing.T) {
+	tests := []struct {
+		src   string
+		token Token
+	}{
+		{"0", INT},
+		{"123", INT},
+		{"1_000_000", INT},
+		{"0x1F", INT},
+		{"0o17", INT},
+		{"0b1010", INT},
+		{"0b1_0_1_0", INT},
+		{"1.5", FLOAT},
+		{"0.5", FLOAT},
+		{"1.", FLOAT},
+		{"1.5e10", FLOAT},
+		{"1.5E-10", FLOAT},
+		{"1e10", FLOAT},
+		{"0x1.8p+3", FLOAT},
+		{"0x1.Fp10", FLOAT},
+		{"123i16", INT},
+		{"123i8", INT},
+		{"10u8", INT},
+		{"10u64", INT},
+		{"1.5f32", FLOAT},
+		{"1.5f64", FLOAT},
+		{"1f32", FLOAT},
+	}
+	for _, tt := range tests {
+		token, literal, errs := scanOneNumber(tt.src)
+		if token != tt.token {
+			t.Errorf("scanNumber(%q): token = %v, want %v", tt.src, token, tt.token)
+		}
+		if literal != tt.src {
+			t.Errorf("scanNumber(%q): literal = %q, want %q", tt.src, literal, tt.src)
+		}
+		if errs != 0 {
+			t.Errorf("scanNumber(%q): got %d errors, want 0", tt.src, errs)
+		}
+	}
+}
+
+func TestScanNumberInvalid(t *testing.T) {
+	tests := []string{
+		"0x_",     // no digits after base prefix
+		"0x_1F",   // separator directly after the base prefix has no preceding digit
+		"1__2",    // doubled separator
+		"1.e",     // exponent has no digits
+		"0b2",     // '2' is not a binary digit
+		"0123",    // leading zero followed by another decimal digit
+		"0x1.5",   // hex mantissa with no 'p' exponent
+		"0x1.5e3", // 'e' exponent on a hex mantissa, which requires 'p'
+		"1.5p10",  // 'p' is not a valid exponent marker for a decimal
+		// mantissa, so it is scanned as an (invalid) type suffix instead
+		"0o8",  // '8' is not an octal digit
+		"1_",   // trailing separator
+		"123x", // unrecognized suffix
+	}
+	for _, src := range tests {
+		_, _, errs := scanOneNumber(src)
+		if errs == 0 {
+			t.Errorf("scanNumber(%q): want at least one error, got none", src)
+		}
+	}
+}
+
+func TestScanNumberThenOperator(t *testing.T) {
+	// a digit separator must not swallow an unrelated trailing token
+	fset := NewFileSet()
+	const src = "1_000+2"
+	file := fset.AddFile("number.panda", len(src))
+	scanner := NewScanner(file, []byte(src), nil, false, nil)
+
+	_, token, literal := scanner.Scan()
+	if token != INT || literal != "1_000" {
+		t.Fatalf("first token = %v %q, want INT %q", token, literal, "1_000")
+	}
+	_, token, _ = scanner.Scan()
+	if token != ADD {
+		t.Fatalf("second token = %v, want ADD", token)
+	}
+	_, token, literal = scanner.Scan()
+	if token != INT || literal != "2" {
+		t.Fatalf("third token = %v %q, want INT %q", token, literal, "2")
+	}
+}
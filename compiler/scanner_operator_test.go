@@ -0,0 +1,73 @@
+package compiler
+
+import "testing"
+
+// scanOneOperator scans a single token from src, which must contain
+// exactly one operator or punctuation lexeme, and returns it.
+func scanOneOperator(src string) Token {
+	fset := NewFileSet()
+	file := fset.AddFile("op.panda", len(src))
+	scanner := NewScanner(file, []byte(src), nil, false, nil)
+	_, token, _ := scanner.Scan()
+	return token
+}
+
+func TestScanOperators(t *testing.T) {
+	tests := []struct {
+		src   string
+		token Token
+	}{
+		{"+", ADD},
+		{"-", SUB},
+		{"*", MUL},
+		{"/", QUO},
+		{"%", REM},
+		{"&", AND},
+		{"|", OR},
+		{"^", XOR},
+		{"<<", SHL},
+		{">>", SHR},
+		{"&^", AND_NOT},
+		{"+=", ADD_ASSIGN},
+		{"-=", SUB_ASSIGN},
+		{"*=", MUL_ASSIGN},
+		{"/=", QUO_ASSIGN},
+		{"%=", REM_ASSIGN},
+		{"&=", AND_ASSIGN},
+		{"|=", OR_ASSIGN},
+		{"^=", XOR_ASSIGN},
+		{"<<=", SHL_ASSIGN},
+		{">>=", SHR_ASSIGN},
+		{"&^=", AND_NOT_ASSIGN},
+		{"&&", LAND},
+		{"||", LOR},
+		{"++", INC},
+		{"--", DEC},
+		{"==", EQL},
+		{"<", LSS},
+		{">", GTR},
+		{"=", ASSIGN},
+		{"!", NOT},
+		{"!=", NEQ},
+		{"<=", LEQ},
+		{">=", GEQ},
+		{":=", DEFINE},
+		{"...", ELLIPSIS},
+		{"..", RANGE},
+		{"(", LPAREN},
+		{"[", LBRACK},
+		{"{", LBRACE},
+		{",", COMMA},
+		{".", PERIOD},
+		{")", RPAREN},
+		{"]", RBRACK},
+		{"}", RBRACE},
+		{";", SEMICOLON},
+		{":", COLON},
+	}
+	for _, tt := range tests {
+		if got := scanOneOperator(tt.src); got != tt.token {
+			t.Errorf("scanOneOperator(%q) = %v, want %v", tt.src, got, tt.token)
+		}
+	}
+}
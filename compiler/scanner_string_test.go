@@ -0,0 +1,139 @@
+package compiler
+
+import "testing"
+
+// scanAll scans src to EOF and returns the number of errors reported.
+func scanAll(src string) int {
+	fset := NewFileSet()
+	file := fset.AddFile("string.panda", len(src))
+	var errs int
+	errHandler := func(Position, string) { errs++ }
+	scanner := NewScanner(file, []byte(src), errHandler, false, nil)
+	for {
+		_, token, _ := scanner.Scan()
+		if token == EOF {
+			break
+		}
+	}
+	return errs
+}
+
+// scannedToken is one (token, literal) pair produced by scanning up to
+// and including the terminating semicolon, for tests that care about the
+// exact shape of an interpolated string's token sequence.
+type scannedToken struct {
+	token   Token
+	literal string
+}
+
+func scanAllTokens(src string) []scannedToken {
+	fset := NewFileSet()
+	file := fset.AddFile("string.panda", len(src))
+	scanner := NewScanner(file, []byte(src), nil, false, nil)
+	var got []scannedToken
+	for {
+		_, token, literal := scanner.Scan()
+		if token == EOF {
+			break
+		}
+		got = append(got, scannedToken{token, literal})
+	}
+	return got
+}
+
+// TestScanInterpolatedStringTokenSequence mirrors the request's own
+// "abc${expr}def" example: a double-quoted string with one interpolated
+// expression splits into STRING_START/INTERP_EXPR_START/.../
+// INTERP_EXPR_END/STRING_END, each literal carrying whichever of the
+// opening and closing quote borders that segment.
+func TestScanInterpolatedStringTokenSequence(t *testing.T) {
+	src := `"hello ${name}!"` + "\n"
+	want := []scannedToken{
+		{STRING_START, `"hello `},
+		{INTERP_EXPR_START, ""},
+		{IDENT, "name"},
+		{INTERP_EXPR_END, "}"},
+		{STRING_END, `!"`},
+		{SEMICOLON, "\n"},
+	}
+	got := scanAllTokens(src)
+	if len(got) != len(want) {
+		t.Fatalf("scanAllTokens(%q) = %v, want %v", src, got, want)
+	}
+	for i, w := range want {
+		if got[i] != w {
+			t.Errorf("scanAllTokens(%q)[%d] = %+v, want %+v", src, i, got[i], w)
+		}
+	}
+}
+
+// TestScanInterpolatedStringNestedBraces checks that a map literal
+// (or any brace-delimited expression) inside "${...}" doesn't
+// prematurely close the interpolation: stringStack must track brace
+// depth so only the '}' that matches the opening "${" ends it.
+func TestScanInterpolatedStringNestedBraces(t *testing.T) {
+	src := `"${ {"a":1}["a"] }"` + "\n"
+	want := []scannedToken{
+		{STRING_START, `"`},
+		{INTERP_EXPR_START, ""},
+		{LBRACE, ""},
+		{STRING, `"a"`},
+		{COLON, ""},
+		{INT, "1"},
+		{RBRACE, ""},
+		{LBRACK, ""},
+		{STRING, `"a"`},
+		{RBRACK, ""},
+		{INTERP_EXPR_END, "}"},
+		{STRING_END, `"`},
+		{SEMICOLON, "\n"},
+	}
+	got := scanAllTokens(src)
+	if len(got) != len(want) {
+		t.Fatalf("scanAllTokens(%q) = %v, want %v", src, got, want)
+	}
+	for i, w := range want {
+		if got[i] != w {
+			t.Errorf("scanAllTokens(%q)[%d] = %+v, want %+v", src, i, got[i], w)
+		}
+	}
+}
+
+// TestScanRawStringDoesNotInterpolate confirms that backtick raw strings
+// scan "${" as ordinary literal text rather than opening an
+// interpolation, unlike double-quoted strings.
+func TestScanRawStringDoesNotInterpolate(t *testing.T) {
+	src := "`raw ${not interpolated}`\n"
+	want := []scannedToken{
+		{STRING, "`raw ${not interpolated}`"},
+		{SEMICOLON, "\n"},
+	}
+	got := scanAllTokens(src)
+	if len(got) != len(want) {
+		t.Fatalf("scanAllTokens(%q) = %v, want %v", src, got, want)
+	}
+	for i, w := range want {
+		if got[i] != w {
+			t.Errorf("scanAllTokens(%q)[%d] = %+v, want %+v", src, i, got[i], w)
+		}
+	}
+}
+
+func TestScanInterpolatedStringUnterminatedAtEOF(t *testing.T) {
+	tests := []string{
+		`"unterminated ${expr`,
+		`"unterminated ${expr}`,
+	}
+	for _, src := range tests {
+		if errs := scanAll(src); errs == 0 {
+			t.Errorf("scanAll(%q): want at least one error, got none", src)
+		}
+	}
+}
+
+func TestScanInterpolatedStringTerminated(t *testing.T) {
+	src := `"hello ${name}!"`
+	if errs := scanAll(src); errs != 0 {
+		t.Errorf("scanAll(%q): got %d errors, want 0", src, errs)
+	}
+}
@@ -0,0 +1,94 @@
+package compiler
+
+import "unicode/utf8"
+
+// source is a rune-level cursor over an in-memory byte buffer. It plays
+// the same role as the allocation-free front end the Go compiler's own
+// scanner adopted in its 2020 rewrite: nextch() decodes one rune of
+// lookahead at a time instead of re-decoding UTF-8 on every access, and
+// startLit/segment/stopLit let a caller mark a run of bytes and hand it
+// back as a []byte slice into buf, with no per-token allocation beyond
+// the final string conversion the caller chooses to do.
+type source struct {
+	buf []byte
+
+	r, b int // r = offset of ch in buf; b = offset just past ch
+	lit  int // offset where the active literal starts, -1 if none
+
+	ch  rune
+	chw int // width of ch in bytes, 0 at EOF
+}
+
+// init wraps buf for scanning and primes ch with its first rune. It
+// resets src in place so callers can embed a source by value instead of
+// allocating one separately.
+func (src *source) init(buf []byte) {
+	src.buf = buf
+	src.lit = -1
+	src.nextch()
+}
+
+// offset returns the byte offset of the current rune, ch.
+func (src *source) offset() int {
+	return src.r
+}
+
+// size returns the size of the underlying buffer.
+func (src *source) size() int {
+	return len(src.buf)
+}
+
+// peek returns the byte following ch without consuming anything, or 0
+// at EOF.
+func (src *source) peek() byte {
+	if src.b < len(src.buf) {
+		return src.buf[src.b]
+	}
+	return 0
+}
+
+// nextch decodes the rune following the current one into ch. It does
+// not itself reject NUL bytes, invalid UTF-8 or byte-order marks --
+// Scanner.next wraps nextch to do that, since only it has access to
+// the error handler and line table.
+func (src *source) nextch() {
+	src.r = src.b
+	if src.b >= len(src.buf) {
+		src.ch = eof
+		src.chw = 0
+		return
+	}
+	r, w := rune(src.buf[src.b]), 1
+	if r >= utf8.RuneSelf {
+		r, w = utf8.DecodeRune(src.buf[src.b:])
+	}
+	src.b += w
+	src.ch = r
+	src.chw = w
+}
+
+// startLit begins accumulating a literal at the current rune.
+func (src *source) startLit() {
+	src.lit = src.r
+}
+
+// startLitAt is startLit backdated to an earlier offset, for callers
+// that want to include a delimiter consumed just before the call (the
+// opening quote of a string, the leading '/' of a comment, ...).
+func (src *source) startLitAt(offset int) {
+	src.lit = offset
+}
+
+// segment returns the literal bytes accumulated since startLit, without
+// ending it.
+func (src *source) segment() []byte {
+	return src.buf[src.lit:src.r]
+}
+
+// stopLit ends the active literal and returns its bytes as a slice into
+// buf -- no copy.
+func (src *source) stopLit() []byte {
+	lit := src.segment()
+	src.lit = -1
+	return lit
+}
@@ -0,0 +1,249 @@
+package compiler
+
+// Token is the set of lexical tokens of the Panda language.
+type Token int
+
+const (
+	ILLEGAL Token = iota
+	EOF
+	COMMENT
+
+	literalBeg
+	IDENT  // main
+	INT    // 12345
+	FLOAT  // 123.45
+	CHAR   // 'a'
+	STRING // "abc"
+	META   // @name
+
+	// interpolated string segments: `"abc${` scans as STRING_START(`"abc`),
+	// `}abc${` as STRING_MID(`abc`), and the closing `}abc"` as
+	// STRING_END(`abc"`); each literal includes whichever of the opening
+	// and closing quote borders that segment, same as plain STRING
+	// includes both. A string with no "${" at all scans as plain STRING
+	// instead of this triple.
+	STRING_START
+	STRING_MID
+	STRING_END
+	literalEnd
+
+	operatorBeg
+	ADD // +
+	SUB // -
+	MUL // *
+	QUO // /
+	REM // %
+
+	AND     // &
+	OR      // |
+	XOR     // ^
+	SHL     // <<
+	SHR     // >>
+	AND_NOT // &^
+
+	ADD_ASSIGN // +=
+	SUB_ASSIGN // -=
+	MUL_ASSIGN // *=
+	QUO_ASSIGN // /=
+	REM_ASSIGN // %=
+
+	AND_ASSIGN     // &=
+	OR_ASSIGN      // |=
+	XOR_ASSIGN     // ^=
+	SHL_ASSIGN     // <<=
+	SHR_ASSIGN     // >>=
+	AND_NOT_ASSIGN // &^=
+
+	LAND // &&
+	LOR  // ||
+	INC  // ++
+	DEC  // --
+
+	EQL    // ==
+	LSS    // <
+	GTR    // >
+	ASSIGN // =
+	NOT    // !
+
+	NEQ      // !=
+	LEQ      // <=
+	GEQ      // >=
+	DEFINE   // :=
+	ELLIPSIS // ...
+	RANGE    // ..
+
+	LPAREN // (
+	LBRACK // [
+	LBRACE // {
+	COMMA  // ,
+	PERIOD // .
+
+	RPAREN    // )
+	RBRACK    // ]
+	RBRACE    // }
+	SEMICOLON // ;
+	COLON     // :
+
+	INTERP_EXPR_START // the "${" that opens an interpolated expression
+	INTERP_EXPR_END   // the "}" that closes one
+	operatorEnd
+
+	keywordBeg
+	BREAK
+	CONTINUE
+	RETURN
+	keywordEnd
+)
+
+var tokens = map[Token]string{
+	ILLEGAL: "ILLEGAL",
+	EOF:     "EOF",
+	COMMENT: "COMMENT",
+
+	IDENT:  "IDENT",
+	INT:    "INT",
+	FLOAT:  "FLOAT",
+	CHAR:   "CHAR",
+	STRING: "STRING",
+	META:   "META",
+
+	STRING_START: "STRING_START",
+	STRING_MID:   "STRING_MID",
+	STRING_END:   "STRING_END",
+
+	ADD: "+",
+	SUB: "-",
+	MUL: "*",
+	QUO: "/",
+	REM: "%",
+
+	AND:     "&",
+	OR:      "|",
+	XOR:     "^",
+	SHL:     "<<",
+	SHR:     ">>",
+	AND_NOT: "&^",
+
+	ADD_ASSIGN: "+=",
+	SUB_ASSIGN: "-=",
+	MUL_ASSIGN: "*=",
+	QUO_ASSIGN: "/=",
+	REM_ASSIGN: "%=",
+
+	AND_ASSIGN:     "&=",
+	OR_ASSIGN:      "|=",
+	XOR_ASSIGN:     "^=",
+	SHL_ASSIGN:     "<<=",
+	SHR_ASSIGN:     ">>=",
+	AND_NOT_ASSIGN: "&^=",
+
+	LAND: "&&",
+	LOR:  "||",
+	INC:  "++",
+	DEC:  "--",
+
+	EQL:    "==",
+	LSS:    "<",
+	GTR:    ">",
+	ASSIGN: "=",
+	NOT:    "!",
+
+	NEQ:      "!=",
+	LEQ:      "<=",
+	GEQ:      ">=",
+	DEFINE:   ":=",
+	ELLIPSIS: "...",
+	RANGE:    "..",
+
+	LPAREN: "(",
+	LBRACK: "[",
+	LBRACE: "{",
+	COMMA:  ",",
+	PERIOD: ".",
+
+	RPAREN:    ")",
+	RBRACK:    "]",
+	RBRACE:    "}",
+	SEMICOLON: ";",
+	COLON:     ":",
+
+	INTERP_EXPR_START: "${",
+	INTERP_EXPR_END:   "}",
+
+	BREAK:    "break",
+	CONTINUE: "continue",
+	RETURN:   "return",
+}
+
+// String returns the string representation of a token.
+func (t Token) String() string {
+	if s, ok := tokens[t]; ok {
+		return s
+	}
+	return "token(" + itoa(int(t)) + ")"
+}
+
+// itoa is a small local replacement for strconv.Itoa to avoid an extra
+// import for the rare case a Token has no registered name.
+func itoa(n int) string {
+	if n == 0 {
+		return "0"
+	}
+	neg := n < 0
+	if neg {
+		n = -n
+	}
+	var buf [20]byte
+	i := len(buf)
+	for n > 0 {
+		i--
+		buf[i] = byte('0' + n%10)
+		n /= 10
+	}
+	if neg {
+		i--
+		buf[i] = '-'
+	}
+	return string(buf[i:])
+}
+
+var keywords map[string]Token
+
+func init() {
+	keywords = make(map[string]Token)
+	for i := keywordBeg + 1; i < keywordEnd; i++ {
+		keywords[tokens[i]] = i
+	}
+}
+
+// Lookup maps an identifier to its keyword token or IDENT.
+func Lookup(ident string) Token {
+	if token, ok := keywords[ident]; ok {
+		return token
+	}
+	return IDENT
+}
+
+// IsLiteral returns true for tokens corresponding to identifiers and
+// basic type literals.
+func (t Token) IsLiteral() bool {
+	return literalBeg < t && t < literalEnd
+}
+
+// IsKeyword returns true for tokens corresponding to keywords.
+func (t Token) IsKeyword() bool {
+	return keywordBeg < t && t < keywordEnd
+}
+
+// canEndStatement reports whether a token of this kind can appear at
+// the end of a statement, i.e. whether the scanner should insert an
+// automatic semicolon when a newline follows it.
+func (t Token) canEndStatement() bool {
+	switch t {
+	case IDENT, INT, FLOAT, CHAR, STRING, STRING_END, META,
+		BREAK, CONTINUE, RETURN,
+		RPAREN, RBRACK, RBRACE, INC, DEC:
+		return true
+	}
+	return false
+}